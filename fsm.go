@@ -1,151 +1,133 @@
 package fsm
 
-import (
-	"fmt"
-)
-
+// State is the package's original, string-keyed state representation.
+// Guard, Ruleset, Machine and the other type aliases in this file are
+// instantiations of their Typed counterparts (see typed.go) over State, so
+// the string-keyed API and the generic TypedMachine[T] API share a single
+// implementation instead of being maintained as two hand-synced copies.
+// Reach for TypedMachine[T] directly when a typed enum state is worth the
+// extra type parameter at the call site; apart from Trigger, RulesetOptions
+// and Phase, which both APIs use as they are, everything in this file is a
+// thin, non-generic name for the T=State case.
 type State string
 
+// Trigger names an event that can move a Subject out of a State, without
+// the caller needing to know the destination State. See Ruleset.Permit and
+// Machine.Fire.
+type Trigger string
+
+// RulesetOptions controls how a Ruleset's guards are run under
+// Machine.TransitionContext.
+type RulesetOptions struct {
+	// Sequential runs a Transition's guards one after another instead of
+	// concurrently. Off by default.
+	Sequential bool
+
+	// FailFast cancels the context passed to any still-running guards,
+	// and stops waiting on the rest, as soon as one guard reports an
+	// error, instead of collecting every guard's outcome. Off by
+	// default, matching the behavior of IsValidTransition/Transition.
+	FailFast bool
+}
+
+// Phase marks the point in a transition attempt a NotificationEvent was
+// raised at.
+type Phase string
+
+const (
+	// PhaseBeforeGuards fires once per Transition/TransitionContext/Fire
+	// call, before its guards are evaluated. A Fire whose Trigger is not
+	// permitted from the current State skips it and raises only
+	// PhaseGuardFailed.
+	PhaseBeforeGuards Phase = "before_guards"
+	// PhaseGuardFailed fires when no rule is registered for the attempt,
+	// or a registered rule's guards deny it.
+	PhaseGuardFailed Phase = "guard_failed"
+	// PhaseTransitioned fires once the Subject has successfully moved to
+	// To, after any Enter/Exit handlers have run.
+	PhaseTransitioned Phase = "transitioned"
+	// PhaseRejected fires when guards passed but an Enter or Exit
+	// handler then errored, rolling the Subject back to From. It also
+	// fires when a transition chained by an auto-advancing Enter fails;
+	// the Subject is then left at To, or wherever the chain stopped, and
+	// is not rolled back to From.
+	PhaseRejected Phase = "rejected"
+)
+
 // Guard provides protection against transitioning to the goal State.
 // Returning an error or nil indicates if the transition is permitted or not.
-type Guard func(subject Stater, goal State) error
+type Guard = TypedGuard[State]
 
-// Transition is the change between States
-type Transition interface {
-	Origin() State
-	Exit() State
-}
+// GuardCtx is a Guard that is passed a context.Context, derived from the one
+// given to Machine.TransitionContext. It should return promptly when ctx is
+// Done rather than continuing to do work whose result can no longer matter.
+// A Guard registered via AddRule/AddNamedRule/AddTransition still runs
+// under TransitionContext; it is simply never passed the context and so
+// can't observe cancellation itself. Guards registered via Permit are run
+// only by Fire, which passes no context.
+type GuardCtx = TypedGuardCtx[State]
+
+// Transition is the change between States.
+type Transition = TypedTransition[State]
 
 // T implements the Transition interface; it provides a default
 // implementation of a Transition.
-type T struct {
-	O, E State
-}
-
-func (t T) Origin() State { return t.O }
-func (t T) Exit() State   { return t.E }
+type T = TypedT[State]
 
 // Ruleset stores the rules for the state machine.
-type Ruleset map[Transition][]Guard
-
-// AddRule adds Guards for the given Transition
-func (r Ruleset) AddRule(t Transition, guards ...Guard) {
-	for _, guard := range guards {
-		r[t] = append(r[t], guard)
-	}
-}
-
-// AddTransition adds a transition with a default rule
-func (r Ruleset) AddTransition(t Transition) {
-	r.AddRule(t, func(subject Stater, goal State) error {
-		if subject.CurrentState() != t.Origin() {
-			return fmt.Errorf("invalid transition from %s to %s", subject.CurrentState(), t.Origin())
-		}
-		return nil
-	})
-}
-
-// CreateRuleset will establish a ruleset with the provided transitions.
-// This eases initialization when storing within another structure.
-func CreateRuleset(transitions ...Transition) Ruleset {
-	r := Ruleset{}
+type Ruleset = TypedRuleset[State]
 
-	for _, t := range transitions {
-		r.AddTransition(t)
-	}
+// StateHandler allows a State to react to being entered or exited.
+// Enter is called once the Subject has been moved into the State; if it
+// returns a non-empty State, the Machine immediately attempts to transition
+// on to that State, chaining until a handler returns an empty State. Exit is
+// called before the Subject leaves the State and should be idempotent, since
+// a rolled-back transition may cause it to run without a matching Enter.
+type StateHandler = TypedStateHandler[State]
 
-	return r
-}
+// ErrInvalidTransition is returned when no transition is defined between
+// two States.
+type ErrInvalidTransition = TypedErrInvalidTransition[State]
 
-//ErrInvalidTransition is returned when no transition is defined between
-type ErrInvalidTransition struct {
-	Transition
-}
-
-//Error returns ErrInvalidTransition error message
-func (e ErrInvalidTransition) Error() string {
-	return fmt.Sprintf("error no transition from %s to %s", e.Origin(), e.Exit())
-}
-
-// IsValidTransition determines if a transition is allowed.
-// This occurs in parallel.
-// NOTE: Guards are not halted if they are short-circuited for some
-// transition. They may continue running *after* the outcome is determined.
-// Returns a list of errors if the transition is invalid or nil otherwise
-func (r Ruleset) IsValidTransition(subject Stater, goal State) []error {
-	attempt := T{subject.CurrentState(), goal}
-
-	if guards, ok := r[attempt]; ok {
-		outcome := make(chan error)
-
-		for _, guard := range guards {
-			go func(g Guard) {
-				outcome <- g(subject, goal)
-			}(guard)
-		}
-
-		guardErrors := []error{}
-		for range guards {
-			if err := <-outcome; err != nil {
-				guardErrors = append(guardErrors, err)
-			}
-		}
-		if len(guardErrors) > 0 {
-			return guardErrors
-		}
-
-		return nil // All guards passed
-	}
-	return []error{ErrInvalidTransition{attempt}}
-}
+// ErrInvalidTrigger is returned when no Trigger is permitted from a State.
+type ErrInvalidTrigger = TypedErrInvalidTrigger[State]
 
 // Stater can be passed into the FSM. The Stater is reponsible for setting
 // its own default state. Behavior of a Stater without a State is undefined.
-type Stater interface {
-	CurrentState() State
-	SetState(State)
-}
+type Stater = TypedStater[State]
+
+// NotificationEvent describes a single point in a transition attempt, as
+// delivered to an Observer.
+type NotificationEvent = TypedNotificationEvent[State]
+
+// Observer receives NotificationEvents from every Machine it's registered
+// with via Machine.AddObserver.
+type Observer = TypedObserver[State]
 
 // Machine is a pairing of Rules and a Subject.
 // The subject or rules may be changed at any time within
 // the machine's lifecycle.
-type Machine struct {
-	Rules   *Ruleset
-	Subject Stater
-}
+type Machine = TypedMachine[State]
 
-// Transition attempts to move the Subject to the Goal state.
-func (m Machine) Transition(goal State) []error {
-	transitionErrors := m.Rules.IsValidTransition(m.Subject, goal)
-	if len(transitionErrors) == 0 {
-		m.Subject.SetState(goal)
-		return nil
-	}
-
-	return transitionErrors
+// CreateRuleset will establish a ruleset with the provided transitions.
+// This eases initialization when storing within another structure.
+func CreateRuleset(transitions ...Transition) Ruleset {
+	return CreateTypedRuleset[State](transitions...)
 }
 
 // New initializes a machine
 func New(opts ...func(*Machine)) Machine {
-	var m Machine
-
-	for _, opt := range opts {
-		opt(&m)
-	}
-
-	return m
+	return NewTyped[State](opts...)
 }
 
 // WithSubject is intended to be passed to New to set the Subject
 func WithSubject(s Stater) func(*Machine) {
-	return func(m *Machine) {
-		m.Subject = s
-	}
+	return WithTypedSubject[State](s)
 }
 
-// WithRules is intended to be passed to New to set the Rules
-func WithRules(r Ruleset) func(*Machine) {
-	return func(m *Machine) {
-		m.Rules = &r
-	}
+// WithRules is intended to be passed to New to set the Rules. It takes r by
+// pointer, rather than copying it, so that AddRule/AddHandler/Permit/
+// SubstateOf calls made on r after New still reach the Machine.
+func WithRules(r *Ruleset) func(*Machine) {
+	return WithTypedRules[State](r)
 }
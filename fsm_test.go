@@ -1,6 +1,7 @@
 package fsm_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -72,7 +73,7 @@ func TestMachineTransition(t *testing.T) {
 	rules.AddTransition(fsm.T{"started", "finished"})
 
 	some_thing := Thing{State: "pending"}
-	the_machine := fsm.New(fsm.WithRules(rules), fsm.WithSubject(&some_thing))
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
 
 	// should not be able to transition to the current state
 	err := the_machine.Transition("pending")
@@ -89,6 +90,382 @@ func TestMachineTransition(t *testing.T) {
 	st.Expect(t, some_thing.State, fsm.State("started"))
 }
 
+// TestWithRulesAliasesCaller ensures WithRules shares the caller's Ruleset
+// rather than copying it, so rules added after New still take effect. A
+// Ruleset's internal maps are allocated lazily on first write; a value
+// receiver here would silently carry nil maps forever if WithRules ran
+// before AddTransition.
+func TestWithRulesAliasesCaller(t *testing.T) {
+	rules := fsm.Ruleset{}
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	st.Expect(t, the_machine.Transition("started"), []error(nil))
+	st.Expect(t, some_thing.State, fsm.State("started"))
+}
+
+// countingHandler records how many times Enter and Exit are called, and
+// optionally auto-advances to Next on Enter.
+type countingHandler struct {
+	Next     fsm.State
+	Enters   int
+	Exits    int
+	EnterErr error
+	ExitErr  error
+}
+
+func (h *countingHandler) Enter(subject fsm.Stater) (fsm.State, error) {
+	h.Enters++
+	if h.EnterErr != nil {
+		return "", h.EnterErr
+	}
+	return h.Next, nil
+}
+
+func (h *countingHandler) Exit(subject fsm.Stater) error {
+	h.Exits++
+	return h.ExitErr
+}
+
+func TestMachineTransitionHandlers(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+	rules.AddTransition(fsm.T{"started", "finished"})
+
+	pendingHandler := &countingHandler{}
+	startedHandler := &countingHandler{}
+	rules.AddHandler("pending", pendingHandler)
+	rules.AddHandler("started", startedHandler)
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	err := the_machine.Transition("started")
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, some_thing.State, fsm.State("started"))
+	st.Expect(t, pendingHandler.Exits, 1)
+	st.Expect(t, startedHandler.Enters, 1)
+}
+
+func TestMachineTransitionHandlerChaining(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+	rules.AddTransition(fsm.T{"started", "finished"})
+
+	startedHandler := &countingHandler{Next: "finished"}
+	rules.AddHandler("started", startedHandler)
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	err := the_machine.Transition("started")
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, some_thing.State, fsm.State("finished"))
+	st.Expect(t, startedHandler.Enters, 1)
+}
+
+func TestMachineTransitionHandlerRollback(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	failErr := errors.New("enter failed")
+	rules.AddHandler("started", &countingHandler{EnterErr: failErr})
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	err := the_machine.Transition("started")
+	st.Expect(t, err, []error{failErr})
+	st.Expect(t, some_thing.State, fsm.State("pending"))
+}
+
+func TestRulesetNamedRule(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+	rules.AddNamedRule(fsm.T{"pending", "started"}, "isOwner", func(subject fsm.Stater, goal fsm.State) error {
+		return nil
+	})
+
+	st.Expect(t, rules.GuardNames(fsm.T{"pending", "started"}), []string{"", "isOwner"})
+	st.Expect(t, len(rules.Transitions()), 1)
+}
+
+func TestMachineFire(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.Permit("pending", "start", "started")
+	rules.Permit("started", "finish", "finished")
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	// should not be able to fire a trigger not permitted from the current state
+	err := the_machine.Fire("finish")
+	st.Expect(t, err[0], fsm.ErrInvalidTrigger{"pending", "finish"})
+	st.Expect(t, some_thing.State, fsm.State("pending"))
+
+	// should be able to fire a permitted trigger
+	err = the_machine.Fire("start")
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, some_thing.State, fsm.State("started"))
+}
+
+func TestMachineFireGuard(t *testing.T) {
+	rules := fsm.Ruleset{}
+	denied := errors.New("not allowed")
+	rules.Permit("pending", "start", "started", func(subject fsm.Stater, goal fsm.State) error {
+		return denied
+	})
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	err := the_machine.Fire("start")
+	st.Expect(t, err, []error{denied})
+	st.Expect(t, some_thing.State, fsm.State("pending"))
+}
+
+func TestRulesetSubstateFallback(t *testing.T) {
+	rules := fsm.Ruleset{}
+	err := rules.SubstateOf("started", "active")
+	st.Expect(t, err, nil)
+	err = rules.SubstateOf("paused", "active")
+	st.Expect(t, err, nil)
+	rules.AddTransition(fsm.T{"active", "finished"})
+
+	// no direct rule from "started", falls back to the "active" superstate
+	st.Expect(t, rules.IsValidTransition(&Thing{State: "started"}, "finished"), []error(nil))
+	st.Expect(t, rules.IsValidTransition(&Thing{State: "paused"}, "finished"), []error(nil))
+}
+
+func TestRulesetSubstateCycle(t *testing.T) {
+	rules := fsm.Ruleset{}
+	err := rules.SubstateOf("active", "running")
+	st.Expect(t, err, nil)
+
+	err = rules.SubstateOf("running", "active")
+	if err == nil {
+		t.Fatal("expected an error registering a cyclic substate configuration")
+	}
+}
+
+func TestMachineTransitionHierarchyHandlers(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.SubstateOf("started", "active")
+	rules.SubstateOf("paused", "active")
+	rules.AddTransition(fsm.T{"active", "finished"})
+	rules.AddTransition(fsm.T{"started", "paused"})
+
+	activeHandler := &countingHandler{}
+	startedHandler := &countingHandler{}
+	pausedHandler := &countingHandler{}
+	rules.AddHandler("active", activeHandler)
+	rules.AddHandler("started", startedHandler)
+	rules.AddHandler("paused", pausedHandler)
+
+	some_thing := Thing{State: "started"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	// "started" -> "paused" share the "active" superstate: only the
+	// substates should be exited/entered, not "active" itself.
+	err := the_machine.Transition("paused")
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, startedHandler.Exits, 1)
+	st.Expect(t, pausedHandler.Enters, 1)
+	st.Expect(t, activeHandler.Exits, 0)
+	st.Expect(t, activeHandler.Enters, 0)
+
+	// "paused" -> "finished" leaves the "active" superstate entirely.
+	err = the_machine.Transition("finished")
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, pausedHandler.Exits, 1)
+	st.Expect(t, activeHandler.Exits, 1)
+}
+
+func TestMachineTransitionContextFailFast(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.Options = fsm.RulesetOptions{FailFast: true}
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	canceled := make(chan bool, 1)
+	rules.AddRuleCtx(fsm.T{"pending", "started"}, func(ctx context.Context, subject fsm.Stater, goal fsm.State) error {
+		<-ctx.Done()
+		canceled <- true
+		return ctx.Err()
+	})
+	rules.AddRuleCtx(fsm.T{"pending", "started"}, func(ctx context.Context, subject fsm.Stater, goal fsm.State) error {
+		return errors.New("denied")
+	})
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	err := the_machine.TransitionContext(context.Background(), "started")
+	if len(err) == 0 {
+		t.Fatal("expected transition to be denied")
+	}
+	st.Expect(t, some_thing.State, fsm.State("pending"))
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the slow guard's context to be canceled once the fast guard failed")
+	}
+}
+
+func TestMachineTransitionContextDeadline(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+	rules.AddRuleCtx(fsm.T{"pending", "started"}, func(ctx context.Context, subject fsm.Stater, goal fsm.State) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := the_machine.TransitionContext(ctx, "started")
+	st.Expect(t, err, []error{context.DeadlineExceeded})
+}
+
+// recordingObserver collects NotificationEvents on a channel so tests can
+// wait for them without racing the observer goroutine.
+type recordingObserver struct {
+	events chan fsm.NotificationEvent
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{events: make(chan fsm.NotificationEvent, 16)}
+}
+
+func (o *recordingObserver) Notify(e fsm.NotificationEvent) {
+	o.events <- e
+}
+
+func (o *recordingObserver) next(t *testing.T) fsm.NotificationEvent {
+	t.Helper()
+	select {
+	case e := <-o.events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a NotificationEvent")
+		return fsm.NotificationEvent{}
+	}
+}
+
+func TestMachineObserver(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	observer := newRecordingObserver()
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+	the_machine.AddObserver(observer)
+
+	err := the_machine.Transition("started")
+	st.Expect(t, err, []error(nil))
+
+	before := observer.next(t)
+	st.Expect(t, before.Phase, fsm.PhaseBeforeGuards)
+	st.Expect(t, before.From, fsm.State("pending"))
+	st.Expect(t, before.To, fsm.State("started"))
+
+	done := observer.next(t)
+	st.Expect(t, done.Phase, fsm.PhaseTransitioned)
+}
+
+func TestMachineObserverGuardFailed(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	observer := newRecordingObserver()
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+	the_machine.AddObserver(observer)
+
+	the_machine.Transition("finished")
+
+	observer.next(t) // PhaseBeforeGuards
+	failed := observer.next(t)
+	st.Expect(t, failed.Phase, fsm.PhaseGuardFailed)
+}
+
+func TestMachineCloseStopsObserverGoroutine(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{"pending", "started"})
+
+	observer := newRecordingObserver()
+	some_thing := Thing{State: "pending"}
+	the_machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(&some_thing))
+	the_machine.AddObserver(observer)
+	the_machine.Close()
+
+	// Closed, so notifications are dropped rather than delivered; this
+	// must not block even though nothing ever reads observer.events.
+	err := the_machine.Transition("started")
+	st.Expect(t, err, []error(nil))
+
+	// Safe to call again, and safe on a Machine that never had an
+	// Observer at all.
+	the_machine.Close()
+	fsm.Machine{}.Close()
+}
+
+// OrderState is a typed enum state, used below to demonstrate
+// TypedMachine/TypedRuleset alongside the string-keyed Machine/Ruleset
+// exercised by the rest of this file.
+type OrderState int
+
+const (
+	OrderPending OrderState = iota
+	OrderShipped
+	OrderDelivered
+)
+
+// Order is a minimal struct that is an fsm.TypedStater[OrderState].
+type Order struct {
+	State OrderState
+}
+
+func (o *Order) CurrentState() OrderState { return o.State }
+func (o *Order) SetState(s OrderState)    { o.State = s }
+
+func TestTypedMachineTransition(t *testing.T) {
+	rules := fsm.TypedRuleset[OrderState]{}
+	rules.AddTransition(fsm.TypedT[OrderState]{O: OrderPending, E: OrderShipped})
+	rules.AddTransition(fsm.TypedT[OrderState]{O: OrderShipped, E: OrderDelivered})
+
+	some_order := Order{State: OrderPending}
+	the_machine := fsm.NewTyped(fsm.WithTypedRules(&rules), fsm.WithTypedSubject(&some_order))
+
+	// should not be able to transition to the current state
+	err := the_machine.Transition(OrderPending)
+	st.Expect(t, err, []error{fsm.TypedErrInvalidTransition[OrderState]{fsm.TypedT[OrderState]{O: OrderPending, E: OrderPending}}})
+
+	// should not be able to skip a state
+	err = the_machine.Transition(OrderDelivered)
+	st.Expect(t, err, []error{fsm.TypedErrInvalidTransition[OrderState]{fsm.TypedT[OrderState]{O: OrderPending, E: OrderDelivered}}})
+
+	// a typo in a state name, as with "OrderShiped", is a compile error
+	// here rather than a silently-ignored string mismatch
+	err = the_machine.Transition(OrderShipped)
+	st.Expect(t, err, []error(nil))
+	st.Expect(t, some_order.CurrentState(), OrderShipped)
+}
+
+// TestStringMachineIsMachine demonstrates that StringMachine is the
+// package's original string-keyed Machine under another name, so the two
+// styles shown in this file and TestTypedMachineTransition above are drop-in
+// alternatives rather than two separate APIs to maintain.
+func TestStringMachineIsMachine(t *testing.T) {
+	var m fsm.StringMachine = fsm.Machine{}
+	st.Expect(t, m, fsm.Machine{})
+}
+
 func BenchmarkRulesetParallelGuarding(b *testing.B) {
 	rules := fsm.Ruleset{}
 	rules.AddTransition(fsm.T{"pending", "started"})
@@ -0,0 +1,662 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The types below parameterize the whole Ruleset/Machine API on a
+// comparable type T, so a typo in a state name is a compile error instead
+// of a mismatched transition at runtime (e.g. type OrderState int with
+// iota-declared constants). A state is represented directly by T, with no
+// wrapper type: Go doesn't allow a generic type's underlying type to be its
+// own type parameter, so there is no TypedState[T] to define.
+//
+// This is the package's one implementation of the Ruleset/Machine engine.
+// fsm.go's string-keyed Guard, Ruleset, Machine, Stater and friends are type
+// aliases for their TypedX[State] instantiation here, rather than a second,
+// hand-synced copy of this file with State substituted for T: a fix to
+// guard running, the observer hub, or the substate walk below applies to
+// both APIs at once and the compiler checks that it does. Reach for
+// TypedRuleset[T]/TypedMachine[T] directly when a typed enum is worth the
+// extra type parameter at every call site; everything else can keep using
+// the plain, non-generic names.
+
+// TypedGuard provides protection against transitioning to the goal T.
+// Returning an error or nil indicates if the transition is permitted or not.
+type TypedGuard[T comparable] func(subject TypedStater[T], goal T) error
+
+// TypedGuardCtx is a TypedGuard that is passed a context.Context, derived
+// from the one given to TypedMachine.TransitionContext. It should return
+// promptly when ctx is Done rather than continuing to do work whose result
+// can no longer matter. A TypedGuard registered via AddRule/AddNamedRule/
+// AddTransition still runs under TransitionContext; it is simply never
+// passed the context and so can't observe cancellation itself. Guards
+// registered via Permit are run only by Fire, which passes no context.
+type TypedGuardCtx[T comparable] func(ctx context.Context, subject TypedStater[T], goal T) error
+
+// typedAdaptGuard lifts a context-oblivious TypedGuard to a TypedGuardCtx
+// that ignores ctx.
+func typedAdaptGuard[T comparable](g TypedGuard[T]) TypedGuardCtx[T] {
+	return func(ctx context.Context, subject TypedStater[T], goal T) error {
+		return g(subject, goal)
+	}
+}
+
+// TypedTransition is the change between states.
+type TypedTransition[T comparable] interface {
+	Origin() T
+	Exit() T
+}
+
+// TypedT implements the TypedTransition interface; it provides a default
+// implementation of a TypedTransition.
+type TypedT[T comparable] struct {
+	O, E T
+}
+
+func (t TypedT[T]) Origin() T { return t.O }
+func (t TypedT[T]) Exit() T   { return t.E }
+
+// typedNamedGuard pairs a TypedGuardCtx with an optional name used for
+// diagnostics and diagram labels. Guard funcs aren't comparable, so a
+// TypedRuleset can't map back from a TypedGuard to its name; it has to be
+// kept alongside at registration time.
+type typedNamedGuard[T comparable] struct {
+	name  string
+	guard TypedGuardCtx[T]
+}
+
+// typedTriggerEntry is the dest T and Guards registered against an origin T
+// and Trigger pair via Permit.
+type typedTriggerEntry[T comparable] struct {
+	dest   T
+	guards []typedNamedGuard[T]
+}
+
+// TypedRuleset stores the rules for the state machine.
+type TypedRuleset[T comparable] struct {
+	rules    map[TypedTransition[T]][]typedNamedGuard[T]
+	handlers map[T]TypedStateHandler[T]
+	triggers map[T]map[Trigger]typedTriggerEntry[T]
+	parents  map[T]T
+
+	// Options controls the guard evaluation behavior of
+	// TypedMachine.TransitionContext.
+	Options RulesetOptions
+}
+
+// AddRule adds Guards for the given TypedTransition
+func (r *TypedRuleset[T]) AddRule(t TypedTransition[T], guards ...TypedGuard[T]) {
+	for _, guard := range guards {
+		r.addNamedGuard(t, "", typedAdaptGuard(guard))
+	}
+}
+
+// AddNamedRule adds a TypedGuard for the given TypedTransition, recording
+// name alongside it. The name has no effect on evaluation; it exists so
+// tooling such as fsm/visualize can produce meaningful labels for otherwise
+// anonymous Guard funcs.
+func (r *TypedRuleset[T]) AddNamedRule(t TypedTransition[T], name string, g TypedGuard[T]) {
+	r.addNamedGuard(t, name, typedAdaptGuard(g))
+}
+
+// AddRuleCtx adds context-aware Guards for the given TypedTransition. Unlike
+// a plain TypedGuard, a TypedGuardCtx is passed the context.Context given to
+// TypedMachine.TransitionContext and can watch it for cancellation.
+func (r *TypedRuleset[T]) AddRuleCtx(t TypedTransition[T], guards ...TypedGuardCtx[T]) {
+	for _, guard := range guards {
+		r.addNamedGuard(t, "", guard)
+	}
+}
+
+func (r *TypedRuleset[T]) addNamedGuard(t TypedTransition[T], name string, g TypedGuardCtx[T]) {
+	if r.rules == nil {
+		r.rules = map[TypedTransition[T]][]typedNamedGuard[T]{}
+	}
+	r.rules[t] = append(r.rules[t], typedNamedGuard[T]{name: name, guard: g})
+}
+
+// AddTransition adds a transition with a default rule
+func (r *TypedRuleset[T]) AddTransition(t TypedTransition[T]) {
+	r.AddRule(t, func(subject TypedStater[T], goal T) error {
+		// t.Origin() may be a superstate reached via the fallback search
+		// in IsValidTransition, so check it against subject's whole
+		// ancestor chain rather than its literal current state.
+		for _, o := range r.ancestors(subject.CurrentState()) {
+			if o == t.Origin() {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid transition from %v to %v", subject.CurrentState(), t.Origin())
+	})
+}
+
+// AddHandler registers a TypedStateHandler whose Enter and Exit methods are
+// called by TypedMachine.Transition whenever the Subject enters or leaves
+// state.
+func (r *TypedRuleset[T]) AddHandler(state T, h TypedStateHandler[T]) {
+	if r.handlers == nil {
+		r.handlers = map[T]TypedStateHandler[T]{}
+	}
+	r.handlers[state] = h
+}
+
+// Permit registers dest as the state reached from origin when trigger is
+// fired, subject to guards. It lives alongside the goal-state-based rules
+// added via AddRule/AddTransition; a TypedRuleset may use either style, or
+// both, for different parts of the same state graph.
+func (r *TypedRuleset[T]) Permit(origin T, trigger Trigger, dest T, guards ...TypedGuard[T]) {
+	if r.triggers == nil {
+		r.triggers = map[T]map[Trigger]typedTriggerEntry[T]{}
+	}
+	if r.triggers[origin] == nil {
+		r.triggers[origin] = map[Trigger]typedTriggerEntry[T]{}
+	}
+
+	entry := typedTriggerEntry[T]{dest: dest}
+	for _, g := range guards {
+		entry.guards = append(entry.guards, typedNamedGuard[T]{guard: typedAdaptGuard(g)})
+	}
+	r.triggers[origin][trigger] = entry
+}
+
+// SubstateOf declares child a substate of parent: a transition or trigger
+// with no rule defined directly on child falls back to whatever is defined
+// on parent, and so on up the chain. Returns an error, without modifying
+// the TypedRuleset, if parent is already a descendant of child.
+func (r *TypedRuleset[T]) SubstateOf(child, parent T) error {
+	for cur, ok := parent, true; ok; cur, ok = r.parents[cur] {
+		if cur == child {
+			return fmt.Errorf("fsm: %v is already an ancestor of %v, cannot also be its substate", child, parent)
+		}
+	}
+
+	if r.parents == nil {
+		r.parents = map[T]T{}
+	}
+	r.parents[child] = parent
+	return nil
+}
+
+// ancestors returns s and its superstate chain, in order from s up to the
+// root, as declared via SubstateOf.
+func (r *TypedRuleset[T]) ancestors(s T) []T {
+	chain := []T{s}
+	for cur := s; ; {
+		parent, ok := r.parents[cur]
+		if !ok {
+			return chain
+		}
+		chain = append(chain, parent)
+		cur = parent
+	}
+}
+
+// CreateTypedRuleset will establish a ruleset with the provided transitions.
+// This eases initialization when storing within another structure.
+func CreateTypedRuleset[T comparable](transitions ...TypedTransition[T]) TypedRuleset[T] {
+	r := TypedRuleset[T]{}
+
+	for _, t := range transitions {
+		r.AddTransition(t)
+	}
+
+	return r
+}
+
+// Transitions returns every TypedTransition registered in the TypedRuleset,
+// in no particular order.
+func (r *TypedRuleset[T]) Transitions() []TypedTransition[T] {
+	ts := make([]TypedTransition[T], 0, len(r.rules))
+	for t := range r.rules {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// GuardNames returns the name supplied via AddNamedRule for each TypedGuard
+// attached to t, in registration order. A TypedGuard added via AddRule or
+// AddTransition without a name is represented by an empty string.
+func (r *TypedRuleset[T]) GuardNames(t TypedTransition[T]) []string {
+	guards := r.rules[t]
+	names := make([]string, len(guards))
+	for i, g := range guards {
+		names[i] = g.name
+	}
+	return names
+}
+
+// TypedErrInvalidTransition is returned when no transition is defined between
+type TypedErrInvalidTransition[T comparable] struct {
+	TypedTransition[T]
+}
+
+// Error returns TypedErrInvalidTransition's error message
+func (e TypedErrInvalidTransition[T]) Error() string {
+	return fmt.Sprintf("error no transition from %v to %v", e.Origin(), e.Exit())
+}
+
+// typedRunGuards runs guards against subject and goal in parallel, as
+// IsValidTransition documents, and collects their errors.
+// NOTE: Guards are not halted if they are short-circuited for some
+// transition. They may continue running *after* the outcome is determined.
+func typedRunGuards[T comparable](guards []typedNamedGuard[T], subject TypedStater[T], goal T) []error {
+	return typedRunGuardsContext(context.Background(), guards, subject, goal, RulesetOptions{})
+}
+
+// typedRunGuardsContext runs guards against subject and goal under ctx,
+// honoring opts.Sequential and opts.FailFast. The channel is always
+// buffered to the number of guards so that, when returning early under
+// FailFast, goroutines for guards that haven't been read yet can still
+// deliver their result instead of leaking.
+func typedRunGuardsContext[T comparable](ctx context.Context, guards []typedNamedGuard[T], subject TypedStater[T], goal T, opts RulesetOptions) []error {
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	guardErrors := []error{}
+
+	if opts.Sequential {
+		for _, guard := range guards {
+			if err := guard.guard(cctx, subject, goal); err != nil {
+				guardErrors = append(guardErrors, err)
+				if opts.FailFast {
+					break
+				}
+			}
+		}
+		return guardErrors
+	}
+
+	outcome := make(chan error, len(guards))
+	for _, guard := range guards {
+		go func(g TypedGuardCtx[T]) {
+			outcome <- g(cctx, subject, goal)
+		}(guard.guard)
+	}
+
+	for range guards {
+		if err := <-outcome; err != nil {
+			guardErrors = append(guardErrors, err)
+			if opts.FailFast {
+				cancel() // let any still-running TypedGuardCtx funcs observe cancellation and return early
+				break
+			}
+		}
+	}
+	return guardErrors
+}
+
+// IsValidTransition determines if a transition is allowed.
+// This occurs in parallel.
+// NOTE: Guards are not halted if they are short-circuited for some
+// transition. They may continue running *after* the outcome is determined.
+// If no TypedTransition is registered for the Subject's current state, and
+// that state was declared a substate via SubstateOf, its superstate chain
+// is searched in turn for a matching TypedTransition.
+// Returns a list of errors if the transition is invalid or nil otherwise
+func (r *TypedRuleset[T]) IsValidTransition(subject TypedStater[T], goal T) []error {
+	origin := subject.CurrentState()
+
+	for _, o := range r.ancestors(origin) {
+		if guards, ok := r.rules[TypedT[T]{o, goal}]; ok {
+			if guardErrors := typedRunGuards(guards, subject, goal); len(guardErrors) > 0 {
+				return guardErrors
+			}
+			return nil // All guards passed
+		}
+	}
+	return []error{TypedErrInvalidTransition[T]{TypedT[T]{origin, goal}}}
+}
+
+// IsValidTransitionContext is IsValidTransition run under ctx: guards are
+// given ctx (or, with r.Options.FailFast, a copy canceled as soon as any
+// guard reports an error) so a TypedGuardCtx doing I/O can stop promptly
+// instead of running to completion after the outcome no longer matters.
+func (r *TypedRuleset[T]) IsValidTransitionContext(ctx context.Context, subject TypedStater[T], goal T) []error {
+	origin := subject.CurrentState()
+
+	for _, o := range r.ancestors(origin) {
+		if guards, ok := r.rules[TypedT[T]{o, goal}]; ok {
+			if guardErrors := typedRunGuardsContext(ctx, guards, subject, goal, r.Options); len(guardErrors) > 0 {
+				return guardErrors
+			}
+			return nil // All guards passed
+		}
+	}
+	return []error{TypedErrInvalidTransition[T]{TypedT[T]{origin, goal}}}
+}
+
+// TypedErrInvalidTrigger is returned when no Trigger is permitted from a state
+type TypedErrInvalidTrigger[T comparable] struct {
+	Origin  T
+	Trigger Trigger
+}
+
+// Error returns TypedErrInvalidTrigger's error message
+func (e TypedErrInvalidTrigger[T]) Error() string {
+	return fmt.Sprintf("error trigger %s not permitted from %v", e.Trigger, e.Origin)
+}
+
+// TypedStater can be passed into the FSM. The TypedStater is responsible for
+// setting its own default state. Behavior of a TypedStater without a state
+// is undefined.
+type TypedStater[T comparable] interface {
+	CurrentState() T
+	SetState(T)
+}
+
+// TypedStateHandler allows a state to react to being entered or exited.
+// Enter is called once the Subject has been moved into the state; if it
+// returns a non-empty state, the TypedMachine immediately attempts to
+// transition on to that state, chaining until a handler returns the zero
+// value of T. Exit is called before the Subject leaves the state and should
+// be idempotent, since a rolled-back transition may cause it to run without
+// a matching Enter.
+type TypedStateHandler[T comparable] interface {
+	Enter(subject TypedStater[T]) (T, error)
+	Exit(subject TypedStater[T]) error
+}
+
+// TypedNotificationEvent describes a single point in a transition attempt,
+// as delivered to a TypedObserver.
+type TypedNotificationEvent[T comparable] struct {
+	From   T
+	To     T
+	Phase  Phase
+	Errors []error
+	Time   time.Time
+}
+
+// TypedObserver receives TypedNotificationEvents from every TypedMachine
+// it's registered with via TypedMachine.AddObserver.
+type TypedObserver[T comparable] interface {
+	Notify(TypedNotificationEvent[T])
+}
+
+// typedObserverHub fans TypedNotificationEvents out to a TypedMachine's
+// Observers on a buffered channel processed by a dedicated goroutine, so a
+// slow Observer doesn't hold up a transition while fewer than 64 events are
+// queued; once the buffer is full, notify blocks until the goroutine takes
+// an event off it or the hub is closed. The goroutine runs until close
+// is called; callers that register an Observer are expected to close the
+// hub (via TypedMachine.Close) once the TypedMachine is no longer in use,
+// or it leaks.
+type typedObserverHub[T comparable] struct {
+	mu        sync.Mutex
+	observers []TypedObserver[T]
+	events    chan TypedNotificationEvent[T]
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newTypedObserverHub[T comparable]() *typedObserverHub[T] {
+	h := &typedObserverHub[T]{
+		events: make(chan TypedNotificationEvent[T], 64),
+		done:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *typedObserverHub[T]) run() {
+	for {
+		select {
+		case event := <-h.events:
+			h.mu.Lock()
+			observers := append([]TypedObserver[T](nil), h.observers...)
+			h.mu.Unlock()
+
+			for _, o := range observers {
+				o.Notify(event)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *typedObserverHub[T]) add(o TypedObserver[T]) {
+	h.mu.Lock()
+	h.observers = append(h.observers, o)
+	h.mu.Unlock()
+}
+
+// close stops h.run, after which further sends on h.events are dropped
+// instead of delivered. It is safe to call more than once.
+func (h *typedObserverHub[T]) close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// TypedMachine is a pairing of Rules and a Subject.
+// The subject or rules may be changed at any time within
+// the machine's lifecycle.
+type TypedMachine[T comparable] struct {
+	Rules   *TypedRuleset[T]
+	Subject TypedStater[T]
+
+	observers *typedObserverHub[T]
+}
+
+// AddObserver registers o to receive a TypedNotificationEvent for every
+// phase of every future Transition, TransitionContext and Fire call on m.
+func (m *TypedMachine[T]) AddObserver(o TypedObserver[T]) {
+	if m.observers == nil {
+		m.observers = newTypedObserverHub[T]()
+	}
+	m.observers.add(o)
+}
+
+// Close stops the goroutine started by AddObserver, if m ever called it.
+// Call it once m is no longer in use; after Close, TypedNotificationEvents
+// are dropped instead of delivered. It is a no-op on a TypedMachine with no
+// Observers.
+func (m TypedMachine[T]) Close() {
+	if m.observers != nil {
+		m.observers.close()
+	}
+}
+
+// notify delivers a TypedNotificationEvent if any Observers are registered;
+// it is a cheap no-op otherwise.
+func (m TypedMachine[T]) notify(from, to T, phase Phase, errs []error) {
+	if m.observers == nil {
+		return
+	}
+	select {
+	case m.observers.events <- TypedNotificationEvent[T]{From: from, To: to, Phase: phase, Errors: errs, Time: time.Now()}:
+	case <-m.observers.done:
+	}
+}
+
+// Transition attempts to move the Subject to the Goal state. If handlers are
+// registered for the origin or goal states, Exit is called on the origin and
+// Enter on the goal; an error from either rolls the Subject back to its
+// original state and is appended to the returned errors alongside any guard
+// errors. If Enter returns a non-empty state, Transition is called again
+// with that state before returning; if that chained Transition fails, its
+// errors are returned and the Subject is not rolled back past goal.
+func (m TypedMachine[T]) Transition(goal T) []error {
+	origin := m.Subject.CurrentState()
+	m.notify(origin, goal, PhaseBeforeGuards, nil)
+
+	if transitionErrors := m.Rules.IsValidTransition(m.Subject, goal); len(transitionErrors) > 0 {
+		m.notify(origin, goal, PhaseGuardFailed, transitionErrors)
+		return transitionErrors
+	}
+
+	errs := m.moveTo(origin, goal)
+	if errs != nil {
+		m.notify(origin, goal, PhaseRejected, errs)
+		return errs
+	}
+	m.notify(origin, goal, PhaseTransitioned, nil)
+	return nil
+}
+
+// TransitionContext is Transition run under ctx: guards run as
+// IsValidTransitionContext describes, honoring ctx's deadline and
+// m.Rules.Options. The Enter/Exit handler dance afterwards is unaffected by
+// ctx; it does not do I/O of its own and always runs to completion once
+// guards have passed.
+func (m TypedMachine[T]) TransitionContext(ctx context.Context, goal T) []error {
+	origin := m.Subject.CurrentState()
+	m.notify(origin, goal, PhaseBeforeGuards, nil)
+
+	if transitionErrors := m.Rules.IsValidTransitionContext(ctx, m.Subject, goal); len(transitionErrors) > 0 {
+		m.notify(origin, goal, PhaseGuardFailed, transitionErrors)
+		return transitionErrors
+	}
+
+	errs := m.moveTo(origin, goal)
+	if errs != nil {
+		m.notify(origin, goal, PhaseRejected, errs)
+		return errs
+	}
+	m.notify(origin, goal, PhaseTransitioned, nil)
+	return nil
+}
+
+// Fire attempts to move the Subject via trigger, looking up the destination
+// state registered with TypedRuleset.Permit for the Subject's current
+// state. args is accepted to mirror the event/trigger APIs this is modeled
+// on; it is not currently passed to Guards or StateHandlers. Enter/Exit
+// handlers and rollback-on-error behave exactly as with Transition.
+func (m TypedMachine[T]) Fire(trigger Trigger, args ...interface{}) []error {
+	origin := m.Subject.CurrentState()
+
+	var entry typedTriggerEntry[T]
+	found := false
+	for _, o := range m.Rules.ancestors(origin) {
+		if entry, found = m.Rules.triggers[o][trigger]; found {
+			break
+		}
+	}
+	if !found {
+		var noDest T
+		errs := []error{TypedErrInvalidTrigger[T]{origin, trigger}}
+		m.notify(origin, noDest, PhaseGuardFailed, errs)
+		return errs
+	}
+
+	m.notify(origin, entry.dest, PhaseBeforeGuards, nil)
+
+	if guardErrors := typedRunGuards(entry.guards, m.Subject, entry.dest); len(guardErrors) > 0 {
+		m.notify(origin, entry.dest, PhaseGuardFailed, guardErrors)
+		return guardErrors
+	}
+
+	errs := m.moveTo(origin, entry.dest)
+	if errs != nil {
+		m.notify(origin, entry.dest, PhaseRejected, errs)
+		return errs
+	}
+	m.notify(origin, entry.dest, PhaseTransitioned, nil)
+	return nil
+}
+
+// moveTo runs the Enter/Exit handler dance for a move from origin to goal
+// that has already been cleared by guards, rolling the Subject back to
+// origin if a handler errors. When origin and goal share a superstate
+// (declared via SubstateOf), only the states below their common ancestor
+// are exited and entered: Exit runs from origin up to, but not including,
+// the common ancestor; Enter runs from there back down to goal. If an
+// ancestor's Enter auto-advances (returns a non-empty state), entry stops
+// there and a fresh Transition to that state starts immediately, superseding
+// the rest of the chain: Enter is never called for goal or any state between
+// the ancestor and goal, even though the Subject has already been moved to
+// goal. This mirrors the non-hierarchical case, where an auto-advancing
+// Enter likewise supersedes whatever the caller originally asked for.
+func (m TypedMachine[T]) moveTo(origin, goal T) []error {
+	originChain := m.Rules.ancestors(origin)
+	goalChain := m.Rules.ancestors(goal)
+
+	ancestorIdx := map[T]int{}
+	for i, s := range goalChain {
+		ancestorIdx[s] = i
+	}
+
+	exit := originChain
+	enter := goalChain
+	if idx, ok := typedFirstCommon(originChain, ancestorIdx); ok {
+		exit = originChain[:idx]
+		enter = goalChain[:ancestorIdx[originChain[idx]]]
+	}
+
+	for _, s := range exit {
+		if h, ok := m.Rules.handlers[s]; ok {
+			if err := h.Exit(m.Subject); err != nil {
+				return []error{err}
+			}
+		}
+	}
+
+	m.Subject.SetState(goal)
+
+	for i := len(enter) - 1; i >= 0; i-- {
+		h, ok := m.Rules.handlers[enter[i]]
+		if !ok {
+			continue
+		}
+		next, err := h.Enter(m.Subject)
+		if err != nil {
+			m.Subject.SetState(origin)
+			return []error{err}
+		}
+		var noNext T
+		if next != noNext {
+			return m.Transition(next)
+		}
+	}
+
+	return nil
+}
+
+// typedFirstCommon returns the index within chain of the first state that
+// also appears in other, where other is represented as a state->index
+// lookup.
+func typedFirstCommon[T comparable](chain []T, other map[T]int) (int, bool) {
+	for i, s := range chain {
+		if _, ok := other[s]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// NewTyped initializes a machine
+func NewTyped[T comparable](opts ...func(*TypedMachine[T])) TypedMachine[T] {
+	var m TypedMachine[T]
+
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	return m
+}
+
+// WithTypedSubject is intended to be passed to NewTyped to set the Subject
+func WithTypedSubject[T comparable](s TypedStater[T]) func(*TypedMachine[T]) {
+	return func(m *TypedMachine[T]) {
+		m.Subject = s
+	}
+}
+
+// WithTypedRules is intended to be passed to NewTyped to set the Rules. It
+// takes r by pointer, rather than copying it, so that AddRule/AddHandler/
+// Permit/SubstateOf calls made on r after NewTyped still reach the
+// TypedMachine: r's rule/handler/trigger/parent maps are allocated lazily on
+// first write, so a copy taken before that point would carry nil maps
+// forever and silently never see rules added later.
+func WithTypedRules[T comparable](r *TypedRuleset[T]) func(*TypedMachine[T]) {
+	return func(m *TypedMachine[T]) {
+		m.Rules = r
+	}
+}
+
+// StringMachine is Machine, i.e. TypedMachine[State], named to mirror
+// TypedMachine[T] for callers who want to spell out the string-keyed case
+// explicitly rather than relying on Machine's name alone.
+type StringMachine = Machine
@@ -0,0 +1,119 @@
+// Package visualize renders an fsm.Ruleset as a diagram, for generating
+// documentation from state definitions rather than hand-drawing them.
+package visualize
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/utilitywarehouse/fsm"
+)
+
+// edgeLabel describes a single edge of the diagram: the guards attached to
+// a Transition, summarised either by name or by count.
+func edgeLabel(r *fsm.Ruleset, t fsm.Transition) string {
+	names := r.GuardNames(t)
+	if len(names) == 0 {
+		return ""
+	}
+
+	named := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != "" {
+			named = append(named, n)
+		}
+	}
+	if len(named) == 0 {
+		return fmt.Sprintf("%d guard(s)", len(names))
+	}
+	return strings.Join(named, ", ")
+}
+
+// sortedTransitions returns r's Transitions grouped by Origin and ordered
+// deterministically, so repeated calls produce identical output.
+func sortedTransitions(r *fsm.Ruleset) []fsm.Transition {
+	ts := r.Transitions()
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Origin() != ts[j].Origin() {
+			return ts[i].Origin() < ts[j].Origin()
+		}
+		return ts[i].Exit() < ts[j].Exit()
+	})
+	return ts
+}
+
+func currentState(m *fsm.Machine) fsm.State {
+	if m == nil || m.Subject == nil {
+		return ""
+	}
+	return m.Subject.CurrentState()
+}
+
+// DOT writes r as a Graphviz DOT digraph to w. Transitions are grouped by
+// origin and labeled with their guard names (or count, if unnamed). If m is
+// non-nil, m.Subject's current state is drawn as a filled node.
+func DOT(w io.Writer, r *fsm.Ruleset, m *fsm.Machine) error {
+	current := currentState(m)
+
+	if _, err := fmt.Fprintln(w, "digraph fsm {"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "\trankdir=LR;"); err != nil {
+		return err
+	}
+
+	if current != "" {
+		if _, err := fmt.Fprintf(w, "\t%q [style=filled,fillcolor=lightblue];\n", current); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range sortedTransitions(r) {
+		label := edgeLabel(r, t)
+		if label == "" {
+			if _, err := fmt.Fprintf(w, "\t%q -> %q;\n", t.Origin(), t.Exit()); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", t.Origin(), t.Exit(), label); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// Mermaid writes r as a Mermaid stateDiagram-v2 diagram to w. If m is
+// non-nil, m.Subject's current state is marked with a note.
+func Mermaid(w io.Writer, r *fsm.Ruleset, m *fsm.Machine) error {
+	current := currentState(m)
+
+	if _, err := fmt.Fprintln(w, "stateDiagram-v2"); err != nil {
+		return err
+	}
+
+	for _, t := range sortedTransitions(r) {
+		label := edgeLabel(r, t)
+		if label == "" {
+			if _, err := fmt.Fprintf(w, "\t%s --> %s\n", t.Origin(), t.Exit()); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\t%s --> %s: %s\n", t.Origin(), t.Exit(), label); err != nil {
+			return err
+		}
+	}
+
+	if current != "" {
+		if _, err := fmt.Fprintf(w, "\tnote right of %s: current state\n", current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
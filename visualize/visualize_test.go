@@ -0,0 +1,47 @@
+package visualize_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/utilitywarehouse/fsm"
+	"github.com/utilitywarehouse/fsm/visualize"
+)
+
+type Thing struct {
+	State fsm.State
+}
+
+func (t *Thing) CurrentState() fsm.State { return t.State }
+func (t *Thing) SetState(s fsm.State)    { t.State = s }
+
+func TestDOT(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{O: "pending", E: "started"})
+	rules.AddNamedRule(fsm.T{O: "started", E: "finished"}, "isOwner", func(subject fsm.Stater, goal fsm.State) error {
+		return nil
+	})
+
+	subject := &Thing{State: "started"}
+	machine := fsm.New(fsm.WithRules(&rules), fsm.WithSubject(subject))
+
+	var buf strings.Builder
+	err := visualize.DOT(&buf, &rules, &machine)
+	st.Expect(t, err, nil)
+
+	out := buf.String()
+	st.Expect(t, strings.Contains(out, `"pending" -> "started"`), true)
+	st.Expect(t, strings.Contains(out, `"started" -> "finished" [label="isOwner"]`), true)
+	st.Expect(t, strings.Contains(out, `"started" [style=filled,fillcolor=lightblue]`), true)
+}
+
+func TestMermaid(t *testing.T) {
+	rules := fsm.Ruleset{}
+	rules.AddTransition(fsm.T{O: "pending", E: "started"})
+
+	var buf strings.Builder
+	err := visualize.Mermaid(&buf, &rules, nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, strings.Contains(buf.String(), "pending --> started"), true)
+}